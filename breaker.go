@@ -1,80 +1,10 @@
 package gocbr
 
 import (
-	"errors"
 	"sync"
 	"time"
 )
 
-const (
-	defaultInterval = time.Duration(0) * time.Second
-	defaultTimeout  = time.Duration(60) * time.Second
-
-	defaultMaxRequests            = uint32(1)
-	defaultMaxConsecutiveFailures = uint32(5)
-)
-
-// State is a type that represents a state of CircuitBreaker.
-type State int
-
-// These constants are states of CircuitBreaker.
-const (
-	StateClosed State = iota
-	StateHalfOpen
-	StateOpen
-)
-
-var (
-	// ErrTooManyRequests is returned when the CB state is half open and the requests count is over the cb maxRequests
-	ErrTooManyRequests = errors.New("too many requests")
-	// ErrOpenState is returned when the CB state is open
-	ErrOpenState = errors.New("circuit breaker is open")
-)
-
-// Counts holds the numbers of requests and their successes/failures.
-// CircuitBreaker clears the internal Counts either
-// on the change of the state or at the closed-state intervals.
-// Counts ignores the results of the requests sent before clearing.
-type Counts struct {
-	Requests             uint32
-	TotalSuccesses       uint32
-	TotalFailures        uint32
-	ConsecutiveSuccesses uint32
-	ConsecutiveFailures  uint32
-}
-
-// onRequest is called before a request is made through the CircuitBreaker.
-func (c *Counts) onRequest() {
-	c.Requests++
-}
-
-// onSuccess is called when a request through the CircuitBreaker succeeds.
-func (c *Counts) onSuccess() {
-	c.TotalSuccesses++
-	c.ConsecutiveSuccesses++
-	c.ConsecutiveFailures = 0
-}
-
-// onFailure is called when a request through the CircuitBreaker fails.
-func (c *Counts) onFailure() {
-	c.TotalFailures++
-	c.ConsecutiveFailures++
-	c.ConsecutiveSuccesses = 0
-}
-
-// clear clears the internal Counts.
-func (c *Counts) clear() {
-	c.Requests = 0
-	c.TotalSuccesses = 0
-	c.TotalFailures = 0
-	c.ConsecutiveSuccesses = 0
-	c.ConsecutiveFailures = 0
-}
-
-func defaultReadyToTrip(counts Counts) bool {
-	return counts.ConsecutiveFailures > defaultMaxConsecutiveFailures
-}
-
 // Config configures CircuitBreaker:
 //
 // Name is the name of the CircuitBreaker.
@@ -97,88 +27,144 @@ func defaultReadyToTrip(counts Counts) bool {
 // Default ReadyToTrip returns true when the number of consecutive failures is more than 5.
 //
 // OnStateChange is called whenever the state of the CircuitBreaker changes.
+//
+// IsSuccessful is called with the error returned from a request made through
+// Execute or Call to decide whether it should count as a success or a
+// failure. If IsSuccessful is nil, the default treats a nil error as success
+// and any non-nil error as failure. Supplying a custom IsSuccessful lets
+// callers avoid tripping the breaker on errors that aren't service faults,
+// e.g. context.Canceled or an HTTP 4xx translated to an error.
+//
+// SlidingWindow, if non-nil, enables a rolling failure-rate trip policy
+// evaluated alongside ReadyToTrip. See TrackingSettings.SlidingWindow.
+//
+// Metrics, if non-nil, is notified of every request outcome and state
+// change; see MetricsSink.
+//
+// OnStateChangeDetailed, like OnStateChange, is called whenever the state
+// changes, but receives a StateChangeEvent carrying the Counts observed at
+// the transition and the Reason it happened. The two callbacks are
+// independent and both fire if set.
 type Config struct {
-	Name          string
-	MaxRequests   uint32
-	Interval      time.Duration
-	Timeout       time.Duration
-	ReadyToTrip   func(counts Counts) bool
-	OnStateChange func(name string, from State, to State)
+	Name                  string
+	MaxRequests           uint32
+	Interval              time.Duration
+	Timeout               time.Duration
+	ReadyToTrip           func(counts Counts) bool
+	OnStateChange         func(name string, from State, to State)
+	IsSuccessful          func(err error) bool
+	SlidingWindow         *SlidingWindowSettings
+	Metrics               MetricsSink
+	OnStateChangeDetailed func(event StateChangeEvent)
 }
 
-type CircuitBreaker struct {
-	name        string
-	maxRequests uint32
-	interval    time.Duration
-	timeout     time.Duration
+func defaultIsSuccessful(err error) bool {
+	return err == nil
+}
 
-	readyToTrip   func(counts Counts) bool
-	onStateChange func(name string, from State, to State)
+// CircuitBreaker wraps a Tracking state machine with the
+// BeforeRequest/OnSuccess/OnFailure hooks (and the Call/Execute helpers)
+// that most callers want, so they don't have to drive Tracking directly.
+type CircuitBreaker struct {
+	tracking *Tracking
 
-	mutex      sync.Mutex
-	state      State     // defines the state of the circuit breaker
-	generation uint64    // monotonically increasing generation number
-	counts     Counts    // counts of requests and their successes/failures
-	expiry     time.Time // expiry of the current state
+	mutex        sync.RWMutex
+	isSuccessful func(err error) bool
 }
 
 // NewCircuitBreaker returns a new CircuitBreaker configured with the given Settings.
 func NewCircuitBreaker(st Config) *CircuitBreaker {
 	cb := new(CircuitBreaker)
 
-	cb.name = st.Name
-	cb.onStateChange = st.OnStateChange
+	cb.tracking = NewTracking(trackingSettingsFromConfig(st))
+	cb.isSuccessful = isSuccessfulFromConfig(st)
 
-	// Set maxRequests to 1 if it is not set
-	cb.maxRequests = st.MaxRequests
-	if st.MaxRequests == 0 {
-		cb.maxRequests = defaultMaxRequests
-	}
+	return cb
+}
 
-	// Set interval to defaultInterval if it is not set
-	cb.interval = st.Interval
-	if st.Interval <= 0 {
-		cb.interval = defaultInterval
+func trackingSettingsFromConfig(st Config) TrackingSettings {
+	return TrackingSettings{
+		Name:                  st.Name,
+		MaxRequests:           st.MaxRequests,
+		Interval:              st.Interval,
+		Timeout:               st.Timeout,
+		ReadyToTrip:           st.ReadyToTrip,
+		OnStateChange:         st.OnStateChange,
+		SlidingWindow:         st.SlidingWindow,
+		Metrics:               st.Metrics,
+		OnStateChangeDetailed: st.OnStateChangeDetailed,
 	}
+}
 
-	// Set timeout to defaultTimeout if it is not set
-	cb.timeout = st.Timeout
-	if st.Timeout <= 0 {
-		cb.timeout = defaultTimeout
+func isSuccessfulFromConfig(st Config) func(err error) bool {
+	if st.IsSuccessful != nil {
+		return st.IsSuccessful
 	}
+	return defaultIsSuccessful
+}
 
-	// Set readyToTrip to defaultReadyToTrip if it is not set
-	cb.readyToTrip = st.ReadyToTrip
-	if st.ReadyToTrip == nil {
-		cb.readyToTrip = defaultReadyToTrip
-	}
+// UpdateConfig swaps cb's tunable settings in place, without resetting its
+// current state, counts, or generation. Intended for live reconfiguration,
+// e.g. from Manager.UpdateConfig.
+func (cb *CircuitBreaker) UpdateConfig(st Config) {
+	cb.tracking.UpdateSettings(trackingSettingsFromConfig(st))
 
-	cb.reset(time.Now())
+	isSuccessful := isSuccessfulFromConfig(st)
+	cb.mutex.Lock()
+	cb.isSuccessful = isSuccessful
+	cb.mutex.Unlock()
+}
 
-	return cb
+// classify reports whether err counts as a success under cb's current
+// IsSuccessful function.
+func (cb *CircuitBreaker) classify(err error) bool {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	return cb.isSuccessful(err)
+}
+
+// Isolate forces the breaker into the open state until Reset is called,
+// ignoring Timeout -- no automatic half-open probe will be attempted. Use
+// this for incident response when an operator needs to manually cut traffic
+// to a bad dependency.
+func (cb *CircuitBreaker) Isolate() {
+	cb.tracking.Isolate()
 }
 
-// Name returns the name of the TwoStepCircuitBreaker.
+// ForceClosed forces the breaker into the closed state until Reset is
+// called, disabling tripping. Use this to force a breaker closed after a
+// false-positive trip.
+func (cb *CircuitBreaker) ForceClosed() {
+	cb.tracking.ForceClosed()
+}
+
+// Reset clears the breaker's counts and returns it to the closed state
+// under normal tripping rules, undoing any prior Isolate or ForceClosed.
+func (cb *CircuitBreaker) Reset() {
+	cb.tracking.Reset()
+}
+
+// Name returns the name of the CircuitBreaker.
 func (cb *CircuitBreaker) Name() string {
-	return cb.name
+	return cb.tracking.Name()
 }
 
-// State returns the current state of the TwoStepCircuitBreaker.
+// State returns the current state of the CircuitBreaker.
 func (cb *CircuitBreaker) State() State {
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
-
-	now := time.Now()
-	state, _ := cb.currentState(now)
-	return state
+	return cb.tracking.State()
 }
 
 // Counts returns internal counters
 func (cb *CircuitBreaker) Counts() Counts {
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
+	return cb.tracking.Counts()
+}
 
-	return cb.counts
+// WindowCounts returns the requests and failures aggregated across the
+// SlidingWindow's live buckets. It returns a zero WindowCounts if no
+// SlidingWindow was configured.
+func (cb *CircuitBreaker) WindowCounts() WindowCounts {
+	return cb.tracking.WindowCounts()
 }
 
 // BeforeRequest - a hook which is called right before the request is sent
@@ -194,121 +180,33 @@ func (cb *CircuitBreaker) BeforeRequest() error {
 
 // OnSuccess - a hook which is called when the request is successful
 func (cb *CircuitBreaker) OnSuccess() {
-	cb.afterRequest(cb.generation, true)
+	cb.afterRequest(cb.tracking.currentGeneration(), true)
 }
 
 // OnFailure - a hook which is called when the request fails
 func (cb *CircuitBreaker) OnFailure() {
-	cb.afterRequest(cb.generation, false)
-}
-
-func (cb *CircuitBreaker) beforeRequest() (uint64, error) {
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
-
-	now := time.Now()
-	state, generation := cb.currentState(now)
-
-	if state == StateOpen {
-		return generation, ErrOpenState
-	} else if state == StateHalfOpen && cb.counts.Requests >= cb.maxRequests {
-		return generation, ErrTooManyRequests
-	}
-
-	cb.counts.onRequest()
-	return generation, nil
-}
-
-func (cb *CircuitBreaker) afterRequest(before uint64, success bool) {
-	cb.mutex.Lock()
-	defer cb.mutex.Unlock()
-
-	now := time.Now()
-	state, generation := cb.currentState(now)
-	if generation != before {
-		return
-	}
-
-	if success {
-		cb.onSuccess(state, now)
-	} else {
-		cb.onFailure(state, now)
-	}
+	cb.afterRequest(cb.tracking.currentGeneration(), false)
 }
 
-func (cb *CircuitBreaker) onSuccess(state State, now time.Time) {
-	switch state {
-	case StateClosed:
-		cb.counts.onSuccess()
-	case StateHalfOpen:
-		cb.counts.onSuccess()
-		if cb.counts.ConsecutiveSuccesses >= cb.maxRequests {
-			cb.setState(StateClosed, now)
-		}
+// Call runs fn through the CircuitBreaker, threading BeforeRequest/OnSuccess/OnFailure
+// for the caller. The error returned by fn is classified by the Config's
+// IsSuccessful function to decide whether it counts as a success or a
+// failure of the CircuitBreaker.
+func (cb *CircuitBreaker) Call(fn func() error) error {
+	generation, err := cb.beforeRequest()
+	if err != nil {
+		return err
 	}
-}
 
-func (cb *CircuitBreaker) onFailure(state State, now time.Time) {
-	switch state {
-	case StateClosed:
-		cb.counts.onFailure()
-		if cb.readyToTrip(cb.counts) {
-			cb.setState(StateOpen, now)
-		}
-	case StateHalfOpen:
-		cb.setState(StateOpen, now)
-	}
+	err = fn()
+	cb.afterRequest(generation, cb.classify(err))
+	return err
 }
 
-// currentState returns the current state of the CircuitBreaker.
-// It also updates cb.expiry if necessary.
-func (cb *CircuitBreaker) currentState(now time.Time) (State, uint64) {
-	switch cb.state {
-	case StateClosed:
-		if !cb.expiry.IsZero() && cb.expiry.Before(now) {
-			cb.reset(now)
-		}
-	case StateOpen:
-		if cb.expiry.Before(now) {
-			cb.setState(StateHalfOpen, now)
-		}
-	}
-	return cb.state, cb.generation
-}
-
-// setState sets the state of the CircuitBreaker to the given state.
-// It also resets the internal counters.
-func (cb *CircuitBreaker) setState(state State, now time.Time) {
-	if cb.state == state {
-		return
-	}
-
-	prev := cb.state
-	cb.state = state
-
-	cb.reset(now)
-
-	if cb.onStateChange != nil {
-		cb.onStateChange(cb.name, prev, state)
-	}
+func (cb *CircuitBreaker) beforeRequest() (uint64, error) {
+	return cb.tracking.OnRequest()
 }
 
-// reset resets the internal counters and moves the CircuitBreaker to a new generation after a state change.
-func (cb *CircuitBreaker) reset(now time.Time) {
-	cb.generation++
-	cb.counts.clear()
-
-	var zero time.Time
-	switch cb.state {
-	case StateClosed:
-		if cb.interval == 0 {
-			cb.expiry = zero
-		} else {
-			cb.expiry = now.Add(cb.interval)
-		}
-	case StateOpen:
-		cb.expiry = now.Add(cb.timeout)
-	default: // StateHalfOpen
-		cb.expiry = zero
-	}
+func (cb *CircuitBreaker) afterRequest(generation uint64, success bool) {
+	cb.tracking.OnResult(generation, success)
 }
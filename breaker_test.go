@@ -52,3 +52,184 @@ func TestNewCircuitBreaker(t *testing.T) {
 	// Check if the circuit is closed
 	assert.Equalf(t, StateClosed, breaker.State(), "Circuit should be closed")
 }
+
+func TestCircuitBreakerSlidingWindow(t *testing.T) {
+	breakerName := "rate-limited-service"
+
+	breakerSettings := Config{
+		Name: breakerName,
+		SlidingWindow: &SlidingWindowSettings{
+			WindowSize:           time.Second,
+			BucketCount:          10,
+			MinimumRequests:      4,
+			FailureRateThreshold: 0.5,
+		},
+	}
+
+	breaker := NewCircuitBreaker(breakerSettings)
+
+	// 2 successes and 1 failure: below MinimumRequests, so no trip yet.
+	for i := 0; i < 2; i++ {
+		err := breaker.BeforeRequest()
+		assert.NoError(t, err)
+		breaker.OnSuccess()
+	}
+	assert.NoError(t, breaker.BeforeRequest())
+	breaker.OnFailure()
+	assert.Equalf(t, StateClosed, breaker.State(), "Circuit should stay closed below MinimumRequests")
+	assert.Equal(t, WindowCounts{Requests: 3, Failures: 1}, breaker.WindowCounts())
+
+	// A second failure reaches MinimumRequests at a failure rate at threshold.
+	assert.NoError(t, breaker.BeforeRequest())
+	breaker.OnFailure()
+
+	assert.Equalf(t, StateOpen, breaker.State(), "Circuit should be open once the failure rate crosses the threshold")
+	// The window is cleared on the trip so stale failures can't re-trip the
+	// breaker the moment it recovers.
+	assert.Equal(t, WindowCounts{}, breaker.WindowCounts())
+}
+
+func TestCircuitBreakerSlidingWindowDoesNotTripOnSuccess(t *testing.T) {
+	breaker := NewCircuitBreaker(Config{
+		Name: "success-push-service",
+		SlidingWindow: &SlidingWindowSettings{
+			WindowSize:           time.Second,
+			BucketCount:          10,
+			MinimumRequests:      4,
+			FailureRateThreshold: 0.5,
+		},
+	})
+
+	// 2 failures, 1 success: 3 requests, below MinimumRequests.
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, breaker.BeforeRequest())
+		breaker.OnFailure()
+	}
+	assert.NoError(t, breaker.BeforeRequest())
+	breaker.OnSuccess()
+	assert.Equal(t, StateClosed, breaker.State())
+
+	// A second success reaches MinimumRequests (4 requests, 2 failures, rate
+	// 0.5 >= threshold) but must not trip: the policy is only evaluated on
+	// failures, per SlidingWindow's documented semantics.
+	assert.NoError(t, breaker.BeforeRequest())
+	breaker.OnSuccess()
+	assert.Equalf(t, StateClosed, breaker.State(), "a success must never trip the breaker")
+	assert.Equal(t, WindowCounts{Requests: 4, Failures: 2}, breaker.WindowCounts())
+}
+
+func TestCircuitBreakerSlidingWindowRecovery(t *testing.T) {
+	breaker := NewCircuitBreaker(Config{
+		Name:    "recovering-service",
+		Timeout: 10 * time.Millisecond,
+		SlidingWindow: &SlidingWindowSettings{
+			WindowSize:           time.Hour,
+			BucketCount:          10,
+			MinimumRequests:      2,
+			FailureRateThreshold: 0.5,
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, breaker.BeforeRequest())
+		breaker.OnFailure()
+	}
+	assert.Equal(t, StateOpen, breaker.State())
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, StateHalfOpen, breaker.State())
+	assert.NoError(t, breaker.BeforeRequest())
+	breaker.OnSuccess()
+	assert.Equal(t, StateClosed, breaker.State())
+
+	// WindowSize (1h) far exceeds Timeout (10ms), so without clearing the
+	// window on recovery the pre-trip failures would still be live here and
+	// a single new failure would re-trip instantly.
+	assert.NoError(t, breaker.BeforeRequest())
+	breaker.OnFailure()
+	assert.Equalf(t, StateClosed, breaker.State(), "recovery must drop stale pre-trip window history")
+}
+
+type fakeMetricsSink struct {
+	results []string
+	states  []State
+}
+
+func (f *fakeMetricsSink) IncResult(name, result string) {
+	f.results = append(f.results, result)
+}
+
+func (f *fakeMetricsSink) SetState(name string, state State) {
+	f.states = append(f.states, state)
+}
+
+func TestCircuitBreakerMetricsAndDetailedStateChange(t *testing.T) {
+	metrics := &fakeMetricsSink{}
+	var events []StateChangeEvent
+
+	breaker := NewCircuitBreaker(Config{
+		Name: "metered-service",
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+		Metrics: metrics,
+		OnStateChangeDetailed: func(event StateChangeEvent) {
+			events = append(events, event)
+		},
+	})
+
+	// A short-circuited request shouldn't happen yet; drive two failures to trip the breaker.
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, breaker.BeforeRequest())
+		breaker.OnFailure()
+	}
+	assert.Equal(t, StateOpen, breaker.State())
+
+	// The breaker is open, so this request is short-circuited rather than counted as a failure.
+	assert.Equal(t, ErrOpenState, breaker.BeforeRequest())
+
+	assert.Equal(t, []string{"failure", "failure", "short_circuit"}, metrics.results)
+	assert.Equal(t, []State{StateOpen}, metrics.states)
+
+	assert.Len(t, events, 1)
+	assert.Equal(t, ReasonThresholdTripped, events[0].Reason)
+	assert.Equal(t, StateClosed, events[0].From)
+	assert.Equal(t, StateOpen, events[0].To)
+}
+
+func TestCircuitBreakerAdminControls(t *testing.T) {
+	var reasons []Reason
+
+	breaker := NewCircuitBreaker(Config{
+		Name:    "isolated-service",
+		Timeout: time.Millisecond,
+		OnStateChangeDetailed: func(event StateChangeEvent) {
+			reasons = append(reasons, event.Reason)
+		},
+	})
+
+	breaker.Isolate()
+	assert.Equal(t, StateForcedOpen, breaker.State())
+	assert.Equal(t, ErrOpenState, breaker.BeforeRequest())
+
+	// Unlike a normal open breaker, it must not recover on its own even
+	// after Timeout would otherwise have elapsed.
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, StateForcedOpen, breaker.State())
+
+	breaker.ForceClosed()
+	assert.Equal(t, StateForcedClosed, breaker.State())
+
+	// Tripping is disabled while forced closed, however many failures occur.
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, breaker.BeforeRequest())
+		breaker.OnFailure()
+	}
+	assert.Equal(t, StateForcedClosed, breaker.State())
+
+	breaker.Reset()
+	assert.Equal(t, StateClosed, breaker.State())
+	assert.Equal(t, Counts{}, breaker.Counts())
+
+	assert.Equal(t, []Reason{ReasonForcedOpen, ReasonForcedClosed, ReasonReset}, reasons)
+}
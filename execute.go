@@ -0,0 +1,17 @@
+package gocbr
+
+// Execute runs fn through cb, threading BeforeRequest/OnSuccess/OnFailure for
+// the caller and returning fn's result value alongside its error. Like Call,
+// the error is classified by cb's Config.IsSuccessful to decide whether it
+// counts as a success or a failure of the CircuitBreaker.
+func Execute[T any](cb *CircuitBreaker, fn func() (T, error)) (T, error) {
+	generation, err := cb.beforeRequest()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	result, err := fn()
+	cb.afterRequest(generation, cb.classify(err))
+	return result, err
+}
@@ -0,0 +1,151 @@
+package gocbr
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Manager owns a set of named CircuitBreakers, for processes that talk to
+// many downstream services -- each keyed by host, route, or whatever else
+// distinguishes them -- and want a single place to look one up, list them
+// for an admin/metrics endpoint, or reconfigure one at runtime from a live
+// config source.
+type Manager struct {
+	mutex         sync.RWMutex
+	breakers      map[string]*CircuitBreaker
+	defaultConfig Config
+}
+
+// NewManager returns a Manager that creates breakers from defaultConfig,
+// overridden per name by whatever Config is passed to GetOrCreate or
+// UpdateConfig. defaultConfig.Name is ignored; each breaker's Name is the
+// name it's registered under.
+func NewManager(defaultConfig Config) *Manager {
+	return &Manager{
+		breakers:      make(map[string]*CircuitBreaker),
+		defaultConfig: defaultConfig,
+	}
+}
+
+// Get returns the breaker registered under name, if any.
+func (m *Manager) Get(name string) (*CircuitBreaker, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	cb, ok := m.breakers[name]
+	return cb, ok
+}
+
+// GetOrCreate returns the breaker registered under cfg.Name, creating one
+// from the Manager's default Config overridden by cfg if it doesn't exist
+// yet.
+func (m *Manager) GetOrCreate(cfg Config) *CircuitBreaker {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if cb, ok := m.breakers[cfg.Name]; ok {
+		return cb
+	}
+
+	cb := NewCircuitBreaker(mergeConfig(m.defaultConfig, cfg))
+	m.breakers[cfg.Name] = cb
+	return cb
+}
+
+// List returns every registered breaker, ordered by name.
+func (m *Manager) List() []*CircuitBreaker {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	names := make([]string, 0, len(m.breakers))
+	for name := range m.breakers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	breakers := make([]*CircuitBreaker, len(names))
+	for i, name := range names {
+		breakers[i] = m.breakers[name]
+	}
+	return breakers
+}
+
+// Remove unregisters the breaker for name, if any.
+func (m *Manager) Remove(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.breakers, name)
+}
+
+// UpdateConfig reconfigures the breaker registered under name in place,
+// merging cfg over the Manager's default Config, without losing the
+// breaker's current state or counts. It returns an error if no breaker is
+// registered under name.
+func (m *Manager) UpdateConfig(name string, cfg Config) error {
+	m.mutex.RLock()
+	cb, ok := m.breakers[name]
+	m.mutex.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("gocbr: no circuit breaker registered as %q", name)
+	}
+
+	merged := mergeConfig(m.defaultConfig, cfg)
+	merged.Name = name
+	cb.UpdateConfig(merged)
+	return nil
+}
+
+// States returns the current State of every registered breaker, keyed by
+// name, for a single admin/metrics endpoint to consume instead of calling
+// State on each breaker individually.
+func (m *Manager) States() map[string]State {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	states := make(map[string]State, len(m.breakers))
+	for name, cb := range m.breakers {
+		states[name] = cb.State()
+	}
+	return states
+}
+
+// mergeConfig layers override onto base: any zero-valued field in override
+// falls back to base's, except Name, which always comes from override since
+// it's the identity callers key breakers by.
+func mergeConfig(base, override Config) Config {
+	cfg := base
+	cfg.Name = override.Name
+
+	if override.MaxRequests != 0 {
+		cfg.MaxRequests = override.MaxRequests
+	}
+	if override.Interval != 0 {
+		cfg.Interval = override.Interval
+	}
+	if override.Timeout != 0 {
+		cfg.Timeout = override.Timeout
+	}
+	if override.ReadyToTrip != nil {
+		cfg.ReadyToTrip = override.ReadyToTrip
+	}
+	if override.OnStateChange != nil {
+		cfg.OnStateChange = override.OnStateChange
+	}
+	if override.IsSuccessful != nil {
+		cfg.IsSuccessful = override.IsSuccessful
+	}
+	if override.SlidingWindow != nil {
+		cfg.SlidingWindow = override.SlidingWindow
+	}
+	if override.Metrics != nil {
+		cfg.Metrics = override.Metrics
+	}
+	if override.OnStateChangeDetailed != nil {
+		cfg.OnStateChangeDetailed = override.OnStateChangeDetailed
+	}
+
+	return cfg
+}
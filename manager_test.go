@@ -0,0 +1,70 @@
+package gocbr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagerGetOrCreateAndList(t *testing.T) {
+	manager := NewManager(Config{
+		MaxRequests: 2,
+		Timeout:     time.Minute,
+	})
+
+	_, ok := manager.Get("orders")
+	assert.False(t, ok)
+
+	cb := manager.GetOrCreate(Config{Name: "orders"})
+	assert.Equal(t, "orders", cb.Name())
+
+	// A second GetOrCreate for the same name returns the same breaker.
+	again := manager.GetOrCreate(Config{Name: "orders"})
+	assert.Same(t, cb, again)
+
+	manager.GetOrCreate(Config{Name: "payments"})
+
+	found, ok := manager.Get("orders")
+	assert.True(t, ok)
+	assert.Same(t, cb, found)
+
+	names := make([]string, 0)
+	for _, b := range manager.List() {
+		names = append(names, b.Name())
+	}
+	assert.Equal(t, []string{"orders", "payments"}, names)
+
+	manager.Remove("payments")
+	assert.Len(t, manager.List(), 1)
+}
+
+func TestManagerUpdateConfig(t *testing.T) {
+	manager := NewManager(Config{
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 5
+		},
+	})
+
+	cb := manager.GetOrCreate(Config{Name: "inventory"})
+
+	assert.NoError(t, cb.BeforeRequest())
+	cb.OnFailure()
+	assert.Equal(t, uint32(1), cb.Counts().ConsecutiveFailures)
+
+	err := manager.UpdateConfig("inventory", Config{
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+	})
+	assert.NoError(t, err)
+
+	// UpdateConfig must not have reset the counts already accumulated.
+	assert.Equal(t, uint32(1), cb.Counts().ConsecutiveFailures)
+
+	assert.NoError(t, cb.BeforeRequest())
+	cb.OnFailure()
+	assert.Equal(t, StateOpen, cb.State(), "the tightened ReadyToTrip should now be in effect")
+
+	assert.EqualError(t, manager.UpdateConfig("missing", Config{}), `gocbr: no circuit breaker registered as "missing"`)
+}
@@ -0,0 +1,64 @@
+package gocbr
+
+import "time"
+
+// MetricsSink receives per-request and per-state-change events from
+// Tracking. Implementations typically wrap a metrics library (e.g. register
+// a counter vector keyed by breaker name and result, and a gauge keyed by
+// breaker name for the current state) so callers get observability into a
+// breaker without wiring BeforeRequest/OnSuccess/OnFailure bookkeeping
+// themselves.
+type MetricsSink interface {
+	// IncResult is called once per request outcome, with result one of
+	// "success", "failure", or "short_circuit" (the request was rejected by
+	// BeforeRequest/Call/Execute without reaching the caller's function).
+	IncResult(name, result string)
+	// SetState is called whenever the breaker's state changes, with the
+	// state it changed to.
+	SetState(name string, state State)
+}
+
+const (
+	resultSuccess      = "success"
+	resultFailure      = "failure"
+	resultShortCircuit = "short_circuit"
+)
+
+// Reason explains why Tracking transitioned from one state to another, so
+// operators can emit meaningful logs/traces from OnStateChangeDetailed
+// instead of reconstructing intent from From/To alone.
+type Reason int
+
+const (
+	// ReasonThresholdTripped means the closed-state breaker moved to open
+	// because ReadyToTrip (or a configured SlidingWindow) returned true.
+	ReasonThresholdTripped Reason = iota
+	// ReasonTimeoutElapsed means the open-state breaker moved to half-open
+	// because its Timeout elapsed.
+	ReasonTimeoutElapsed
+	// ReasonHalfOpenFailure means a probe request failed while half-open,
+	// moving the breaker back to open.
+	ReasonHalfOpenFailure
+	// ReasonHalfOpenRecovered means enough probe requests succeeded while
+	// half-open, moving the breaker to closed.
+	ReasonHalfOpenRecovered
+	// ReasonForcedOpen means an operator called Isolate.
+	ReasonForcedOpen
+	// ReasonForcedClosed means an operator called ForceClosed.
+	ReasonForcedClosed
+	// ReasonReset means an operator called Reset.
+	ReasonReset
+)
+
+// StateChangeEvent is passed to Config.OnStateChangeDetailed (and
+// TrackingSettings.OnStateChangeDetailed) whenever the breaker's state
+// changes. It carries the Counts observed immediately before the
+// transition, in addition to what the plain OnStateChange callback gets.
+type StateChangeEvent struct {
+	Name   string
+	From   State
+	To     State
+	Counts Counts
+	At     time.Time
+	Reason Reason
+}
@@ -0,0 +1,159 @@
+package gocbr
+
+import "time"
+
+const (
+	defaultWindowSize  = 10 * time.Second
+	defaultBucketCount = 10
+)
+
+// SlidingWindowSettings configures the rolling failure-rate trip policy that
+// Tracking can maintain alongside the cumulative Counts used by ReadyToTrip.
+//
+// WindowSize is the total span of time the window covers. If WindowSize is
+// less than or equal to 0, it defaults to 10 seconds.
+//
+// BucketCount is the number of buckets the window is divided into; each
+// bucket covers WindowSize/BucketCount and is zeroed and reused once it
+// ages out of the window. If BucketCount is less than or equal to 0, it
+// defaults to 10.
+//
+// MinimumRequests is the minimum number of requests that must have been
+// observed within the window before FailureRateThreshold is considered.
+//
+// FailureRateThreshold is the fraction of failed requests (in [0, 1])
+// within the window at or above which Tracking trips to the open state.
+type SlidingWindowSettings struct {
+	WindowSize           time.Duration
+	BucketCount          int
+	MinimumRequests      uint32
+	FailureRateThreshold float64
+}
+
+// WindowCounts holds the numbers of requests and failures aggregated across
+// all of a slidingWindow's live buckets.
+type WindowCounts struct {
+	Requests uint32
+	Failures uint32
+}
+
+type windowBucket struct {
+	requests uint32
+	failures uint32
+}
+
+// slidingWindow is a ring of windowBuckets that Tracking advances and
+// updates in real time to back a rolling failure-rate trip policy.
+type slidingWindow struct {
+	minimumRequests      uint32
+	failureRateThreshold float64
+
+	bucketSize time.Duration
+	buckets    []windowBucket
+	curIndex   int
+	curStart   time.Time
+}
+
+func newSlidingWindow(st SlidingWindowSettings) *slidingWindow {
+	windowSize := st.WindowSize
+	if windowSize <= 0 {
+		windowSize = defaultWindowSize
+	}
+
+	bucketCount := st.BucketCount
+	if bucketCount <= 0 {
+		bucketCount = defaultBucketCount
+	}
+
+	return &slidingWindow{
+		minimumRequests:      st.MinimumRequests,
+		failureRateThreshold: st.FailureRateThreshold,
+		bucketSize:           windowSize / time.Duration(bucketCount),
+		buckets:              make([]windowBucket, bucketCount),
+	}
+}
+
+// advance rotates in and zeroes any buckets that have aged out of the
+// window since the last call, so the current bucket always reflects now.
+func (w *slidingWindow) advance(now time.Time) {
+	if w.curStart.IsZero() {
+		w.curStart = now
+		return
+	}
+
+	steps := int(now.Sub(w.curStart) / w.bucketSize)
+	if steps <= 0 {
+		return
+	}
+
+	zeroSteps := steps
+	if zeroSteps > len(w.buckets) {
+		zeroSteps = len(w.buckets)
+	}
+	for i := 0; i < zeroSteps; i++ {
+		w.curIndex = (w.curIndex + 1) % len(w.buckets)
+		w.buckets[w.curIndex] = windowBucket{}
+	}
+
+	// Advance curStart by the uncapped step count so it never lags real
+	// time; otherwise the next advance would see a large steps again and
+	// re-zero the whole ring, including the bucket just written.
+	w.curStart = w.curStart.Add(time.Duration(steps) * w.bucketSize)
+}
+
+// record advances the window to now and accounts a single request, failed
+// or not, in the current bucket.
+func (w *slidingWindow) record(now time.Time, success bool) {
+	w.advance(now)
+
+	bucket := &w.buckets[w.curIndex]
+	bucket.requests++
+	if !success {
+		bucket.failures++
+	}
+}
+
+// clear drops every bucket's accumulated history. Tracking calls this on
+// every reset (state transition or Interval elapsing) so a breaker that has
+// just recovered, tripped, or been administratively reset doesn't carry
+// pre-transition failures into its next window evaluation.
+func (w *slidingWindow) clear() {
+	for i := range w.buckets {
+		w.buckets[i] = windowBucket{}
+	}
+	w.curIndex = 0
+	w.curStart = time.Time{}
+}
+
+// counts aggregates requests and failures across all live buckets.
+func (w *slidingWindow) counts() WindowCounts {
+	var c WindowCounts
+	for _, b := range w.buckets {
+		c.Requests += b.requests
+		c.Failures += b.failures
+	}
+	return c
+}
+
+// readyToTrip reports whether the aggregated window has seen at least
+// minimumRequests requests with a failure rate at or above
+// failureRateThreshold.
+func (w *slidingWindow) readyToTrip() bool {
+	c := w.counts()
+	if c.Requests < w.minimumRequests {
+		return false
+	}
+	return float64(c.Failures)/float64(c.Requests) >= w.failureRateThreshold
+}
+
+// NewFailureRateReadyToTrip returns a ReadyToTrip function that trips once at
+// least minRequests requests have been observed (since the last reset) and
+// their cumulative failure rate is at or above threshold. Unlike
+// SlidingWindowSettings it works off the cumulative Counts Tracking already
+// keeps, so it can be plugged straight into Config.ReadyToTrip or
+// TrackingSettings.ReadyToTrip without enabling the windowed subsystem.
+func NewFailureRateReadyToTrip(threshold float64, minRequests uint32) func(counts Counts) bool {
+	return func(counts Counts) bool {
+		return counts.Requests >= minRequests && float64(counts.TotalFailures)/float64(counts.Requests) >= threshold
+	}
+}
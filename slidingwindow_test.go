@@ -0,0 +1,32 @@
+package gocbr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindowAdvanceAfterIdleGap(t *testing.T) {
+	w := newSlidingWindow(SlidingWindowSettings{
+		WindowSize:           10 * time.Second,
+		BucketCount:          10,
+		MinimumRequests:      5,
+		FailureRateThreshold: 0.6,
+	})
+
+	start := time.Now()
+	w.record(start, true)
+
+	// An idle gap of 3x WindowSize, then a burst landing in the same
+	// bucket as the stale success. Without re-syncing curStart to now, the
+	// capped zeroing loop leaves curStart lagging, so this record() call
+	// sees a huge steps count again and zeroes the bucket it just wrote.
+	burst := start.Add(30 * time.Second)
+	for i := 0; i < 5; i++ {
+		w.record(burst, false)
+	}
+
+	assert.Equal(t, WindowCounts{Requests: 5, Failures: 5}, w.counts())
+	assert.Truef(t, w.readyToTrip(), "window should trip once stale history has aged out and the burst alone crosses the threshold")
+}
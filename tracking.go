@@ -0,0 +1,479 @@
+package gocbr
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInterval = time.Duration(0) * time.Second
+	defaultTimeout  = time.Duration(60) * time.Second
+
+	defaultMaxRequests            = uint32(1)
+	defaultMaxConsecutiveFailures = uint32(5)
+)
+
+// State is a type that represents a state of Tracking.
+type State int
+
+// These constants are states of Tracking.
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+	// StateForcedOpen is like StateOpen, but doesn't expire on Timeout; it
+	// only ends when Reset or ForceClosed is called. Set by Isolate.
+	StateForcedOpen
+	// StateForcedClosed is like StateClosed, but ReadyToTrip/SlidingWindow
+	// never trips it open; it only ends when Reset or Isolate is called. Set
+	// by ForceClosed.
+	StateForcedClosed
+)
+
+var (
+	// ErrTooManyRequests is returned when the CB state is half open and the requests count is over the cb maxRequests
+	ErrTooManyRequests = errors.New("too many requests")
+	// ErrOpenState is returned when the CB state is open
+	ErrOpenState = errors.New("circuit breaker is open")
+)
+
+// Counts holds the numbers of requests and their successes/failures.
+// Tracking clears the internal Counts either
+// on the change of the state or at the closed-state intervals.
+// Counts ignores the results of the requests sent before clearing.
+type Counts struct {
+	Requests             uint32
+	TotalSuccesses       uint32
+	TotalFailures        uint32
+	ConsecutiveSuccesses uint32
+	ConsecutiveFailures  uint32
+}
+
+// onRequest is called before a request is made through Tracking.
+func (c *Counts) onRequest() {
+	c.Requests++
+}
+
+// onSuccess is called when a request through Tracking succeeds.
+func (c *Counts) onSuccess() {
+	c.TotalSuccesses++
+	c.ConsecutiveSuccesses++
+	c.ConsecutiveFailures = 0
+}
+
+// onFailure is called when a request through Tracking fails.
+func (c *Counts) onFailure() {
+	c.TotalFailures++
+	c.ConsecutiveFailures++
+	c.ConsecutiveSuccesses = 0
+}
+
+// clear clears the internal Counts.
+func (c *Counts) clear() {
+	c.Requests = 0
+	c.TotalSuccesses = 0
+	c.TotalFailures = 0
+	c.ConsecutiveSuccesses = 0
+	c.ConsecutiveFailures = 0
+}
+
+func defaultReadyToTrip(counts Counts) bool {
+	return counts.ConsecutiveFailures > defaultMaxConsecutiveFailures
+}
+
+// TrackingSettings configures a Tracking state machine:
+//
+// Name is the name of the Tracking, passed through to OnStateChange.
+//
+// MaxRequests is the maximum number of requests allowed to pass through
+// when Tracking is half-open.
+// If MaxRequests is 0, Tracking allows only 1 request.
+//
+// Interval is the cyclic period of the closed state
+// for Tracking to clear the internal Counts.
+// If Interval is less than or equal to 0, Tracking doesn't clear internal Counts during the closed state.
+//
+// Timeout is the period of the open state,
+// after which the state of Tracking becomes half-open.
+// If Timeout is less than or equal to 0, the timeout value of Tracking is set to 60 seconds.
+//
+// ReadyToTrip is called with a copy of Counts whenever a request fails in the closed state.
+// If ReadyToTrip returns true, Tracking will be placed into the open state.
+// If ReadyToTrip is nil, default ReadyToTrip is used.
+// Default ReadyToTrip returns true when the number of consecutive failures is more than 5.
+//
+// OnStateChange is called whenever the state of Tracking changes.
+//
+// SlidingWindow, if non-nil, enables a rolling failure-rate trip policy that
+// is evaluated alongside ReadyToTrip: when a request fails in the closed
+// state, Tracking also opens if the window has seen at least
+// SlidingWindow.MinimumRequests requests with a failure rate at or above
+// SlidingWindow.FailureRateThreshold. Successes never trip it. See
+// WindowCounts.
+//
+// Metrics, if non-nil, is notified of every request outcome and state
+// change; see MetricsSink.
+//
+// OnStateChangeDetailed, like OnStateChange, is called whenever the state
+// changes, but receives a StateChangeEvent carrying the Counts observed at
+// the transition and the Reason it happened. The two callbacks are
+// independent and both fire if set.
+type TrackingSettings struct {
+	Name                  string
+	MaxRequests           uint32
+	Interval              time.Duration
+	Timeout               time.Duration
+	ReadyToTrip           func(counts Counts) bool
+	OnStateChange         func(name string, from State, to State)
+	SlidingWindow         *SlidingWindowSettings
+	Metrics               MetricsSink
+	OnStateChangeDetailed func(event StateChangeEvent)
+}
+
+// Tracking is the state machine that backs CircuitBreaker. It can also be
+// driven directly by callers that already own their own request-dispatch
+// layer (a redis client pool, a gRPC interceptor, an HTTP round-tripper that
+// needs to inspect the response before deciding success) and want to share a
+// single tracker across multiple call sites without going through
+// BeforeRequest/OnSuccess/OnFailure.
+type Tracking struct {
+	name        string
+	maxRequests uint32
+	interval    time.Duration
+	timeout     time.Duration
+
+	readyToTrip           func(counts Counts) bool
+	onStateChange         func(name string, from State, to State)
+	onStateChangeDetailed func(event StateChangeEvent)
+	metrics               MetricsSink
+
+	window *slidingWindow // optional rolling failure-rate trip policy
+
+	mutex      sync.Mutex
+	state      State     // defines the state of the tracker
+	generation uint64    // monotonically increasing generation number
+	counts     Counts    // counts of requests and their successes/failures
+	expiry     time.Time // expiry of the current state
+}
+
+// NewTracking returns a new Tracking configured with the given TrackingSettings.
+func NewTracking(st TrackingSettings) *Tracking {
+	t := new(Tracking)
+
+	t.applySettings(st)
+	t.reset(time.Now())
+
+	return t
+}
+
+// applySettings assigns st onto t, applying the same defaults NewTracking
+// does. Callers must hold t.mutex, except during construction.
+func (t *Tracking) applySettings(st TrackingSettings) {
+	t.name = st.Name
+	t.onStateChange = st.OnStateChange
+	t.onStateChangeDetailed = st.OnStateChangeDetailed
+	t.metrics = st.Metrics
+
+	// Set maxRequests to 1 if it is not set
+	t.maxRequests = st.MaxRequests
+	if st.MaxRequests == 0 {
+		t.maxRequests = defaultMaxRequests
+	}
+
+	// Set interval to defaultInterval if it is not set
+	t.interval = st.Interval
+	if st.Interval <= 0 {
+		t.interval = defaultInterval
+	}
+
+	// Set timeout to defaultTimeout if it is not set
+	t.timeout = st.Timeout
+	if st.Timeout <= 0 {
+		t.timeout = defaultTimeout
+	}
+
+	// Set readyToTrip to defaultReadyToTrip if it is not set
+	t.readyToTrip = st.ReadyToTrip
+	if st.ReadyToTrip == nil {
+		t.readyToTrip = defaultReadyToTrip
+	}
+
+	if st.SlidingWindow != nil {
+		w := newSlidingWindow(*st.SlidingWindow)
+		if t.window != nil && t.window.bucketSize == w.bucketSize && len(t.window.buckets) == len(w.buckets) {
+			// Same bucket layout: keep the accumulated history and swap
+			// only the thresholds.
+			t.window.minimumRequests = w.minimumRequests
+			t.window.failureRateThreshold = w.failureRateThreshold
+		} else {
+			t.window = w
+		}
+	} else {
+		t.window = nil
+	}
+}
+
+// UpdateSettings swaps t's tunable thresholds and callbacks in place,
+// without resetting its current state, counts, or generation. Intended for
+// live reconfiguration, e.g. from Manager.UpdateConfig. A SlidingWindow keeps
+// its history unless its WindowSize or BucketCount changes, in which case it
+// starts empty.
+func (t *Tracking) UpdateSettings(st TrackingSettings) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.applySettings(st)
+}
+
+// Name returns the name of Tracking.
+func (t *Tracking) Name() string {
+	return t.name
+}
+
+// State returns the current state of Tracking.
+func (t *Tracking) State() State {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	state, _ := t.currentState(now)
+	return state
+}
+
+// Counts returns internal counters.
+func (t *Tracking) Counts() Counts {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.counts
+}
+
+// WindowCounts returns the requests and failures aggregated across the
+// SlidingWindow's live buckets. It returns a zero WindowCounts if no
+// SlidingWindow was configured.
+func (t *Tracking) WindowCounts() WindowCounts {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.window == nil {
+		return WindowCounts{}
+	}
+	return t.window.counts()
+}
+
+// currentGeneration returns the current generation number, used by
+// CircuitBreaker's OnSuccess/OnFailure hooks. Those hooks report against the
+// generation current when they are called, not the one BeforeRequest admitted
+// the request under, so their results are never discarded as stale.
+func (t *Tracking) currentGeneration() uint64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.generation
+}
+
+// OnRequest reports that a request is about to be made, returning the
+// generation it was admitted under and an error if Tracking is not in a
+// state that allows the request through (open, or half-open with too many
+// requests already in flight).
+func (t *Tracking) OnRequest() (uint64, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	state, generation := t.currentState(now)
+
+	if state == StateOpen || state == StateForcedOpen {
+		t.incMetric(resultShortCircuit)
+		return generation, ErrOpenState
+	} else if state == StateHalfOpen && t.counts.Requests >= t.maxRequests {
+		t.incMetric(resultShortCircuit)
+		return generation, ErrTooManyRequests
+	}
+
+	t.counts.onRequest()
+	return generation, nil
+}
+
+// incMetric reports a request outcome to Metrics, if configured.
+func (t *Tracking) incMetric(result string) {
+	if t.metrics != nil {
+		t.metrics.IncResult(t.name, result)
+	}
+}
+
+// OnResult reports the result of a request previously admitted by
+// OnRequest. generation must be the value OnRequest returned; if Tracking
+// has since moved to a new generation the result is ignored.
+func (t *Tracking) OnResult(generation uint64, success bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	state, currentGeneration := t.currentState(now)
+	if currentGeneration != generation {
+		return
+	}
+
+	if success {
+		t.onSuccess(state, now)
+	} else {
+		t.onFailure(state, now)
+	}
+}
+
+func (t *Tracking) onSuccess(state State, now time.Time) {
+	t.incMetric(resultSuccess)
+	switch state {
+	case StateClosed:
+		t.counts.onSuccess()
+		if t.window != nil {
+			t.window.record(now, true)
+		}
+	case StateHalfOpen:
+		t.counts.onSuccess()
+		if t.counts.ConsecutiveSuccesses >= t.maxRequests {
+			t.setState(StateClosed, now, ReasonHalfOpenRecovered)
+		}
+	case StateForcedClosed:
+		t.counts.onSuccess()
+	}
+}
+
+func (t *Tracking) onFailure(state State, now time.Time) {
+	t.incMetric(resultFailure)
+	switch state {
+	case StateClosed:
+		t.counts.onFailure()
+		trip := t.readyToTrip(t.counts)
+		if t.window != nil {
+			t.window.record(now, false)
+			trip = trip || t.window.readyToTrip()
+		}
+		if trip {
+			t.setState(StateOpen, now, ReasonThresholdTripped)
+		}
+	case StateHalfOpen:
+		t.setState(StateOpen, now, ReasonHalfOpenFailure)
+	case StateForcedClosed:
+		// ReadyToTrip/SlidingWindow are disabled while forced closed, but
+		// counts still accumulate so State/Counts stay informative.
+		t.counts.onFailure()
+	}
+}
+
+// currentState returns the current state of Tracking.
+// It also updates t.expiry if necessary.
+func (t *Tracking) currentState(now time.Time) (State, uint64) {
+	switch t.state {
+	case StateClosed:
+		if !t.expiry.IsZero() && t.expiry.Before(now) {
+			t.reset(now)
+		}
+	case StateOpen:
+		if t.expiry.Before(now) {
+			t.setState(StateHalfOpen, now, ReasonTimeoutElapsed)
+		}
+	}
+	return t.state, t.generation
+}
+
+// setState sets the state of Tracking to the given state, unless it's
+// already in that state. It also resets the internal counters.
+func (t *Tracking) setState(state State, now time.Time, reason Reason) {
+	if t.state == state {
+		return
+	}
+	t.transition(state, now, reason)
+}
+
+// transition unconditionally moves Tracking to state and resets its internal
+// counters, but only notifies Metrics/OnStateChange/OnStateChangeDetailed if
+// the state actually changed, so a no-op admin call (e.g. Reset on an
+// already-closed breaker) doesn't emit a spurious state-change metric or
+// callback.
+func (t *Tracking) transition(state State, now time.Time, reason Reason) {
+	prev := t.state
+	countsAtChange := t.counts
+	t.state = state
+
+	t.reset(now)
+
+	if prev == state {
+		return
+	}
+
+	if t.metrics != nil {
+		t.metrics.SetState(t.name, state)
+	}
+
+	if t.onStateChange != nil {
+		t.onStateChange(t.name, prev, state)
+	}
+
+	if t.onStateChangeDetailed != nil {
+		t.onStateChangeDetailed(StateChangeEvent{
+			Name:   t.name,
+			From:   prev,
+			To:     state,
+			Counts: countsAtChange,
+			At:     now,
+			Reason: reason,
+		})
+	}
+}
+
+// Isolate forces Tracking into the open state until Reset is called,
+// ignoring Timeout -- no automatic half-open probe will be attempted. Use
+// this for incident response when an operator needs to manually cut traffic
+// to a dependency, regardless of how its ReadyToTrip/SlidingWindow policy
+// would otherwise classify requests.
+func (t *Tracking) Isolate() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.transition(StateForcedOpen, time.Now(), ReasonForcedOpen)
+}
+
+// ForceClosed forces Tracking into the closed state until Reset is called,
+// disabling ReadyToTrip/SlidingWindow tripping. Use this to force a breaker
+// closed after a false-positive trip.
+func (t *Tracking) ForceClosed() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.transition(StateForcedClosed, time.Now(), ReasonForcedClosed)
+}
+
+// Reset clears Tracking's counts and returns it to the closed state under
+// normal tripping rules, undoing any prior Isolate or ForceClosed.
+func (t *Tracking) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.transition(StateClosed, time.Now(), ReasonReset)
+}
+
+// reset resets the internal counters and moves Tracking to a new generation after a state change.
+func (t *Tracking) reset(now time.Time) {
+	t.generation++
+	t.counts.clear()
+	if t.window != nil {
+		t.window.clear()
+	}
+
+	var zero time.Time
+	switch t.state {
+	case StateClosed:
+		if t.interval == 0 {
+			t.expiry = zero
+		} else {
+			t.expiry = now.Add(t.interval)
+		}
+	case StateOpen:
+		t.expiry = now.Add(t.timeout)
+	default: // StateHalfOpen, StateForcedOpen, StateForcedClosed
+		t.expiry = zero
+	}
+}